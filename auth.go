@@ -0,0 +1,92 @@
+package xmailer
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+//loginAuth 实现非标准的 "LOGIN" SMTP AUTH 机制：按顺序回应服务器的
+//"Username:"/"Password:" 提示，Office 365、Outlook.com 等服务器常要求使用它
+type loginAuth struct {
+	username string
+	password string
+}
+
+//LoginAuth 创建一个使用 LOGIN 机制鉴权的 smtp.Auth
+func LoginAuth(username, password string) smtp.Auth {
+	return &loginAuth{username: username, password: password}
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("xmailer: unexpected LOGIN server challenge %q", fromServer)
+	}
+}
+
+//xoauth2Auth 实现 Google/Microsoft 的 SASL XOAUTH2 机制，使用 OAuth2 access token 代替密码
+type xoauth2Auth struct {
+	username    string
+	accessToken string
+}
+
+//XOAUTH2Auth 创建一个使用 XOAUTH2 机制鉴权的 smtp.Auth，accessToken 是调用方自行获取的 OAuth2 bearer token
+func XOAUTH2Auth(username, accessToken string) smtp.Auth {
+	return &xoauth2Auth{username: username, accessToken: accessToken}
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	resp := fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", a.username, a.accessToken)
+	return "XOAUTH2", []byte(resp), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// server rejected the bearer token and sent a JSON error challenge;
+		// respond with an empty message to let the server fail the command cleanly
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+//selectAuth 在调用方没有通过 NewXMailerWithAuth 显式指定 smtp.Auth 时，
+//根据服务器在 AUTH 扩展中公布的机制列表自动选择其中最强的一个
+func selectAuth(advertised, host, username, password string) smtp.Auth {
+	if username == "" {
+		return nil
+	}
+
+	mechanisms := strings.Fields(advertised)
+	has := func(name string) bool {
+		for _, mech := range mechanisms {
+			if strings.EqualFold(mech, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case has("CRAM-MD5"):
+		return smtp.CRAMMD5Auth(username, password)
+	case has("LOGIN"):
+		return LoginAuth(username, password)
+	case has("PLAIN"):
+		return smtp.PlainAuth("", username, password, host)
+	default:
+		return nil
+	}
+}
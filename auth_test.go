@@ -0,0 +1,65 @@
+package xmailer
+
+import "testing"
+
+func TestLoginAuthNext(t *testing.T) {
+	a := LoginAuth("user@example.com", "secret")
+
+	resp, err := a.Next([]byte("Username:"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != "user@example.com" {
+		t.Errorf("got %q, want username", resp)
+	}
+
+	resp, err = a.Next([]byte("Password:"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != "secret" {
+		t.Errorf("got %q, want password", resp)
+	}
+
+	if _, err := a.Next([]byte("Something else:"), true); err == nil {
+		t.Error("expected an error on an unrecognized LOGIN challenge")
+	}
+}
+
+func TestXOAUTH2AuthStart(t *testing.T) {
+	a := XOAUTH2Auth("user@example.com", "token123")
+
+	mech, resp, err := a.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mech != "XOAUTH2" {
+		t.Errorf("got mechanism %q, want XOAUTH2", mech)
+	}
+
+	want := "user=user@example.com\x01auth=Bearer token123\x01\x01"
+	if string(resp) != want {
+		t.Errorf("got %q, want %q", resp, want)
+	}
+}
+
+func TestSelectAuthPrefersCRAMMD5(t *testing.T) {
+	auth := selectAuth("PLAIN LOGIN CRAM-MD5", "smtp.example.com", "user", "pass")
+	if auth == nil {
+		t.Fatal("expected a non-nil auth")
+	}
+
+	mech, _, err := auth.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mech != "CRAM-MD5" {
+		t.Errorf("got mechanism %q, want CRAM-MD5", mech)
+	}
+}
+
+func TestSelectAuthWithoutUsername(t *testing.T) {
+	if auth := selectAuth("PLAIN LOGIN CRAM-MD5", "smtp.example.com", "", ""); auth != nil {
+		t.Errorf("expected nil auth without a username, got %v", auth)
+	}
+}
@@ -0,0 +1,336 @@
+package xmailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+//DefaultIdleTimeout 长连接空闲超过该时长后，下一次 Send 会自动重新拨号
+const DefaultIdleTimeout = 30 * time.Second
+
+//SendCloser 既能发送邮件，又能在用完之后关闭底层连接
+type SendCloser interface {
+	Send(m *Message) error
+	Close() error
+}
+
+//Sender 长连接场景下复用的发送方，语义上等价于 SendCloser
+type Sender = SendCloser
+
+//Signer 在 payload 拼装完成、写入 SMTP 连接之前对其签名，典型实现如 DKIM
+type Signer interface {
+	Sign(payload []byte) ([]byte, error)
+}
+
+//Dialer 持有连接 SMTP 服务器所需的凭据与 TLS 配置，mirrors gomail.Dialer
+type Dialer struct {
+	Addr        string
+	Host        string
+	Auth        smtp.Auth
+	Username    string
+	Password    string
+	Signer      Signer
+	TLSConfig   *tls.Config
+	StartTLS    bool
+	LocalName   string
+	IdleTimeout time.Duration
+}
+
+//NewDialer 使用用户名/密码创建 Dialer；具体鉴权机制在 Dial 时根据服务器公布的 AUTH
+//扩展自动选择，不再硬编码为 PlainAuth
+func NewDialer(addr, username, passwd string) (*Dialer, error) {
+	host, err := hostOf(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Dialer{
+		Addr:        addr,
+		Host:        host,
+		Username:    username,
+		Password:    passwd,
+		LocalName:   LocalName,
+		IdleTimeout: DefaultIdleTimeout,
+	}, nil
+}
+
+//NewDialerWithAuth 使用调用方构造好的 smtp.Auth 创建 Dialer，便于接入非标准鉴权方式
+func NewDialerWithAuth(addr string, auth smtp.Auth) (*Dialer, error) {
+	host, err := hostOf(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Dialer{
+		Addr:        addr,
+		Host:        host,
+		Auth:        auth,
+		LocalName:   LocalName,
+		IdleTimeout: DefaultIdleTimeout,
+	}, nil
+}
+
+func hostOf(addr string) (string, error) {
+	pos := strings.Index(addr, ":")
+	if pos == -1 || pos == 0 || pos == len(addr)-1 {
+		return "", fmt.Errorf("invalid smtp server address")
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+
+	return host, nil
+}
+
+//dial 建立一条新的 SMTP 连接并完成 Hello/STARTTLS/AUTH 握手
+func (d *Dialer) dial() (*smtp.Client, error) {
+	var client *smtp.Client
+	var err error
+
+	if d.TLSConfig != nil && !d.StartTLS {
+		conn, derr := tls.Dial("tcp", d.Addr, d.TLSConfig)
+		if derr != nil {
+			return nil, derr
+		}
+		client, err = smtp.NewClient(conn, d.Addr)
+	} else {
+		client, err = smtp.Dial(d.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	localName := d.LocalName
+	if localName == "" {
+		localName = LocalName
+	}
+	if err = client.Hello(localName); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	if d.StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			tlsConfig := d.TLSConfig
+			if tlsConfig == nil {
+				tlsConfig = &tls.Config{ServerName: d.Host}
+			}
+			if err = client.StartTLS(tlsConfig); err != nil {
+				client.Close()
+				return nil, err
+			}
+		}
+	}
+
+	if ok, params := client.Extension("AUTH"); ok {
+		auth := d.Auth
+		if auth == nil {
+			auth = selectAuth(params, d.Host, d.Username, d.Password)
+		}
+		if auth != nil {
+			if err = client.Auth(auth); err != nil {
+				client.Close()
+				return nil, err
+			}
+		}
+	}
+
+	return client, nil
+}
+
+//Dial 拨号并返回一个可在多次 Send 之间复用连接的 Sender，用完需调用 Close
+func (d *Dialer) Dial() (SendCloser, error) {
+	client, err := d.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	return &xsender{dialer: d, client: client, lastUsed: time.Now()}, nil
+}
+
+//DialAndSend 拨号、发送完给定的邮件后立即关闭连接，适合偶发的一次性发送
+func (d *Dialer) DialAndSend(msgs ...*Message) error {
+	s, err := d.Dial()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	for _, m := range msgs {
+		if err := s.Send(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//xsender 是 Sender 的默认实现，复用同一条 SMTP 连接发送多封邮件。连接本身是有状态、
+//串行的协议，mu 保证多个 goroutine 共享同一个 xsender 时，Send/Close 不会交错地
+//读写 client/lastUsed 或在同一条连接上同时对话
+type xsender struct {
+	dialer   *Dialer
+	client   *smtp.Client
+	lastUsed time.Time
+
+	mu sync.Mutex
+}
+
+func (s *xsender) Send(m *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m.FromAddr == "" {
+		return fmt.Errorf("Must specify the From address")
+	}
+	if len(m.To) == 0 {
+		return fmt.Errorf("Must specify at least one To address")
+	}
+	if m.Subject == "" {
+		m.Subject = "无题"
+	}
+
+	if err := s.ensureFresh(); err != nil {
+		return err
+	}
+
+	if err := s.sendOnce(m); err != nil {
+		if !isRetryableNetErr(err) {
+			return err
+		}
+		// connection was idle/broken on the server side, redial once and retry
+		if err := s.redial(); err != nil {
+			return err
+		}
+		return s.sendOnce(m)
+	}
+
+	return nil
+}
+
+func (s *xsender) sendOnce(m *Message) error {
+	if err := s.client.Mail(m.FromAddr); err != nil {
+		return err
+	}
+	for _, t := range m.To {
+		if err := s.client.Rcpt(t); err != nil {
+			return err
+		}
+	}
+
+	w, err := s.client.Data()
+	if err != nil {
+		return err
+	}
+
+	if s.dialer.Signer == nil {
+		// no Signer configured: stream straight through without buffering the
+		// whole message (and its attachments) in memory
+		if _, err := m.WriteTo(w); err != nil {
+			w.Close()
+			return err
+		}
+	} else {
+		// DKIM and similar signers need the fully assembled payload to hash,
+		// so fall back to buffering it before writing
+		payload, err := m.payload()
+		if err != nil {
+			w.Close()
+			return err
+		}
+
+		payload, err = s.dialer.Signer.Sign(payload)
+		if err != nil {
+			w.Close()
+			return err
+		}
+
+		if _, err = w.Write(payload); err != nil {
+			w.Close()
+			return err
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	// the message is delivered as of here: a failure past this point must not
+	// cause Send to redial and resend it. Clear MAIL/RCPT state so the connection
+	// is ready for the next message; if that fails, the connection is left in an
+	// unknown state, so just mark it dead and let the next Send redial instead of
+	// reporting an error for a message that already went out
+	s.lastUsed = time.Now()
+	if err := s.client.Reset(); err != nil {
+		s.client.Close()
+		s.client = nil
+	}
+
+	return nil
+}
+
+//ensureFresh 在空闲超过 IdleTimeout 后提前重新拨号，避免撞上服务器单方面的超时踢出；
+//连接因 RSET 失败被标记为 dead（client 为 nil）时也会在这里重新拨号
+func (s *xsender) ensureFresh() error {
+	if s.client == nil {
+		return s.redial()
+	}
+
+	idleTimeout := s.dialer.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+
+	if time.Since(s.lastUsed) > idleTimeout {
+		return s.redial()
+	}
+
+	return nil
+}
+
+func (s *xsender) redial() error {
+	if s.client != nil {
+		s.client.Close()
+	}
+
+	client, err := s.dialer.dial()
+	if err != nil {
+		return err
+	}
+
+	s.client = client
+	s.lastUsed = time.Now()
+
+	return nil
+}
+
+func (s *xsender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client == nil {
+		return nil
+	}
+
+	return s.client.Quit()
+}
+
+//isRetryableNetErr 判断是否是连接已经被对端关闭/损坏一类的错误，这类错误重新拨号后重试通常可以恢复
+func isRetryableNetErr(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "broken pipe") ||
+		strings.Contains(msg, "use of closed network connection") ||
+		strings.Contains(msg, "connection reset") ||
+		strings.Contains(msg, "EOF")
+}
@@ -0,0 +1,339 @@
+package xmailer
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//acceptAndHandshake accepts one connection on ln and performs the greeting/EHLO
+//exchange, returning the connection and a reader positioned right after it so the
+//caller can drive the rest of the SMTP dialogue for its scenario.
+func acceptAndHandshake(t *testing.T, ln net.Listener) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "220 fake.smtp ESMTP\r\n")
+	if _, err := r.ReadString('\n'); err != nil { // EHLO/HELO
+		t.Fatalf("read hello: %v", err)
+	}
+	fmt.Fprintf(conn, "250 fake.smtp\r\n")
+
+	return conn, r
+}
+
+//handleOneMessageUpToDelivery reads and acknowledges a single MAIL/RCPT/DATA
+//cycle, i.e. everything up to and including the point where the message has
+//been accepted by the server.
+func handleOneMessageUpToDelivery(t *testing.T, conn net.Conn, r *bufio.Reader) {
+	t.Helper()
+
+	for _, want := range []string{"MAIL", "RCPT"} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read %s: %v", want, err)
+		}
+		if !strings.HasPrefix(strings.ToUpper(line), want) {
+			t.Fatalf("got %q, want %s", line, want)
+		}
+		fmt.Fprintf(conn, "250 OK\r\n")
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(strings.ToUpper(line), "DATA") {
+		t.Fatalf("read DATA: %q, %v", line, err)
+	}
+	fmt.Fprintf(conn, "354 End data with <CR><LF>.<CR><LF>\r\n")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read data body: %v", err)
+		}
+		if line == ".\r\n" {
+			break
+		}
+	}
+	fmt.Fprintf(conn, "250 OK\r\n")
+}
+
+//handleOneMessage reads and acknowledges a single MAIL/RCPT/DATA cycle, then the
+//RSET that xsender.sendOnce issues once the message has been accepted.
+func handleOneMessage(t *testing.T, conn net.Conn, r *bufio.Reader) {
+	t.Helper()
+
+	handleOneMessageUpToDelivery(t, conn, r)
+
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(strings.ToUpper(line), "RSET") {
+		t.Fatalf("read RSET: %q, %v", line, err)
+	}
+	fmt.Fprintf(conn, "250 OK\r\n")
+}
+
+func testMessage() *Message {
+	m := NewMessage()
+	m.SetFrom("from", "from@example.com")
+	m.AddTo("to@example.com")
+	m.SetSubject("hi")
+	m.SetText("hello")
+	return m
+}
+
+func TestXsenderReusesConnectionAcrossSends(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, r := acceptAndHandshake(t, ln)
+		defer conn.Close()
+		handleOneMessage(t, conn, r)
+		handleOneMessage(t, conn, r)
+	}()
+
+	d, err := NewDialer(ln.Addr().String(), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := d.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Send(testMessage()); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	if err := s.Send(testMessage()); err != nil {
+		t.Fatalf("second send (reused connection): %v", err)
+	}
+
+	<-done
+}
+
+func TestXsenderRedialsAfterIdleTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		conn, r := acceptAndHandshake(t, ln)
+		handleOneMessage(t, conn, r)
+		conn.Close()
+
+		conn2, r2 := acceptAndHandshake(t, ln)
+		defer conn2.Close()
+		handleOneMessage(t, conn2, r2)
+	}()
+
+	d, err := NewDialer(ln.Addr().String(), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.IdleTimeout = 10 * time.Millisecond
+
+	s, err := d.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Send(testMessage()); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.Send(testMessage()); err != nil {
+		t.Fatalf("second send after idle redial: %v", err)
+	}
+
+	<-done
+}
+
+func TestXsenderRetriesOnceAfterBrokenPipe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		conn, r := acceptAndHandshake(t, ln)
+		handleOneMessage(t, conn, r)
+		// simulate the server dropping the connection mid-dialogue for the
+		// next message, as if it had been killed by the peer
+		conn.Close()
+
+		conn2, r2 := acceptAndHandshake(t, ln)
+		defer conn2.Close()
+		handleOneMessage(t, conn2, r2)
+	}()
+
+	d, err := NewDialer(ln.Addr().String(), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := d.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Send(testMessage()); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+
+	// force the connection closed from the client's perspective so the next
+	// sendOnce hits a retryable network error and exercises the redial path
+	xs := s.(*xsender)
+	xs.client.Close()
+
+	if err := s.Send(testMessage()); err != nil {
+		t.Fatalf("second send after broken-pipe retry: %v", err)
+	}
+
+	<-done
+}
+
+//TestXsenderDoesNotResendOnPostDeliveryRSETFailure guards against re-running
+//sendOnce (and so re-delivering the message) when only the post-delivery RSET
+//fails. The server accepts connections for as long as the test needs: it acks
+//MAIL/RCPT/DATA normally on every connection, but drops the very first
+//connection instead of acking its RSET. Send must still report success for
+//that call (the message was already delivered), and must only have gone out
+//once; a buggy implementation that redials-and-resends on RSET failure would
+//drive mailCount to 3 instead of 2.
+func TestXsenderDoesNotResendOnPostDeliveryRSETFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var mailCount int32
+	var connCount int32
+	acceptDone := make(chan struct{})
+	go func() {
+		defer close(acceptDone)
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			idx := atomic.AddInt32(&connCount, 1)
+			go func() {
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+				fmt.Fprintf(conn, "220 fake.smtp ESMTP\r\n")
+				if _, err := r.ReadString('\n'); err != nil {
+					return
+				}
+				fmt.Fprintf(conn, "250 fake.smtp\r\n")
+
+				if !readAndAck(conn, r, "MAIL") {
+					return
+				}
+				atomic.AddInt32(&mailCount, 1)
+				if !readAndAck(conn, r, "RCPT") {
+					return
+				}
+				if !readDataAndAck(conn, r) {
+					return
+				}
+
+				if idx == 1 {
+					// simulate the connection dying right after DATA was
+					// acked but before RSET could be acked
+					return
+				}
+
+				readAndAck(conn, r, "RSET")
+			}()
+		}
+	}()
+
+	d, err := NewDialer(ln.Addr().String(), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := d.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Send(testMessage()); err != nil {
+		t.Fatalf("first send (RSET fails after delivery): %v", err)
+	}
+	if err := s.Send(testMessage()); err != nil {
+		t.Fatalf("second send after RSET-failure redial: %v", err)
+	}
+
+	ln.Close()
+	<-acceptDone
+
+	if got := atomic.LoadInt32(&mailCount); got != 2 {
+		t.Errorf("got %d MAIL FROM across both sends, want 2 (a post-delivery RSET failure must not cause a resend)", got)
+	}
+}
+
+//readAndAck reads one command line expected to start with want and acks it
+//with "250 OK"; it reports whether the line was read and matched.
+func readAndAck(conn net.Conn, r *bufio.Reader, want string) bool {
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(strings.ToUpper(line), want) {
+		return false
+	}
+	fmt.Fprintf(conn, "250 OK\r\n")
+	return true
+}
+
+//readDataAndAck reads the DATA command, acks it, consumes the dot-terminated
+//body, then acks the end of DATA.
+func readDataAndAck(conn net.Conn, r *bufio.Reader) bool {
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(strings.ToUpper(line), "DATA") {
+		return false
+	}
+	fmt.Fprintf(conn, "354 End data with <CR><LF>.<CR><LF>\r\n")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		if line == ".\r\n" {
+			break
+		}
+	}
+	fmt.Fprintf(conn, "250 OK\r\n")
+	return true
+}
@@ -0,0 +1,164 @@
+//Package dkim 为 xmailer 提供 DKIM 签名能力，实现 xmailer.Signer 接口
+package dkim
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/textproto"
+	"strings"
+)
+
+//Signer 使用 RSA-SHA256、relaxed/relaxed 规范化规则对邮件签名
+type Signer struct {
+	Domain   string
+	Selector string
+	PrivKey  *rsa.PrivateKey
+	Headers  []string
+}
+
+//NewSigner 创建一个 DKIM Signer，headers 是参与签名的头字段名，按 RFC 5322 原始大小写书写即可
+func NewSigner(domain, selector string, privKey *rsa.PrivateKey, headers []string) *Signer {
+	return &Signer{
+		Domain:   domain,
+		Selector: selector,
+		PrivKey:  privKey,
+		Headers:  headers,
+	}
+}
+
+//Sign 在 payload 最前面插入一个 DKIM-Signature 头，并返回带有该头的新 payload
+func (s *Signer) Sign(payload []byte) ([]byte, error) {
+	headerBlock, body, err := splitMessage(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := parseHeaders(headerBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyHash := sha256.Sum256(canonicalizeBodyRelaxed(body))
+	bh := base64.StdEncoding.EncodeToString(bodyHash[:])
+
+	signedHeaders := make([]string, 0, len(s.Headers))
+	for _, name := range s.Headers {
+		if _, ok := headers[strings.ToLower(name)]; ok {
+			signedHeaders = append(signedHeaders, name)
+		}
+	}
+
+	dkimHeader := fmt.Sprintf(
+		"v=1; a=rsa-sha256; c=relaxed/relaxed; d=%s; s=%s; h=%s; bh=%s; b=",
+		s.Domain, s.Selector, strings.Join(signedHeaders, ":"), bh,
+	)
+
+	var canon bytes.Buffer
+	for _, name := range signedHeaders {
+		canon.WriteString(canonicalizeHeaderRelaxed(name, headers[strings.ToLower(name)]))
+	}
+	// the DKIM-Signature header itself is canonicalized last, with an empty b= value,
+	// and with its trailing CRLF stripped per RFC 6376 section 3.7
+	canon.WriteString(canonicalizeHeaderRelaxed("DKIM-Signature", dkimHeader))
+	signedData := bytes.TrimSuffix(canon.Bytes(), []byte("\r\n"))
+
+	hashed := sha256.Sum256(signedData)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.PrivKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return nil, err
+	}
+
+	dkimHeader += base64.StdEncoding.EncodeToString(sig)
+
+	signed := make([]byte, 0, len(payload)+len(dkimHeader)+32)
+	signed = append(signed, []byte(fmt.Sprintf("DKIM-Signature: %s\r\n", dkimHeader))...)
+	signed = append(signed, payload...)
+
+	return signed, nil
+}
+
+//splitMessage 将邮件 payload 切分成头部（含结尾的空行）与正文两部分
+func splitMessage(payload []byte) (headerBlock, body []byte, err error) {
+	idx := bytes.Index(payload, []byte("\r\n\r\n"))
+	if idx == -1 {
+		return nil, nil, fmt.Errorf("dkim: message has no header/body separator")
+	}
+	return payload[:idx+4], payload[idx+4:], nil
+}
+
+//parseHeaders 解析头部为 小写字段名 -> 值 的映射，供签名时按需取值
+func parseHeaders(headerBlock []byte) (map[string]string, error) {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(headerBlock)))
+	mimeHeader, err := reader.ReadMIMEHeader()
+	if err != nil && len(mimeHeader) == 0 {
+		return nil, err
+	}
+
+	headers := make(map[string]string, len(mimeHeader))
+	for name, values := range mimeHeader {
+		if len(values) > 0 {
+			headers[strings.ToLower(name)] = values[len(values)-1]
+		}
+	}
+	return headers, nil
+}
+
+//canonicalizeHeaderRelaxed 按 RFC 6376 3.4.2 的 relaxed 规则规范化单个头字段
+func canonicalizeHeaderRelaxed(name, value string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	value = collapseWSP(value)
+	return fmt.Sprintf("%s:%s\r\n", name, value)
+}
+
+//canonicalizeBodyRelaxed 按 RFC 6376 3.4.4 的 relaxed 规则规范化正文
+func canonicalizeBodyRelaxed(body []byte) []byte {
+	rawLines := strings.Split(string(body), "\r\n")
+
+	lines := make([]string, len(rawLines))
+	for i, line := range rawLines {
+		lines[i] = canonicalizeBodyLineRelaxed(line)
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+//canonicalizeBodyLineRelaxed 按 RFC 6376 3.4.4 规范化正文的单行：行内（含行首）连续的
+//空格/制表符折叠为单个空格，行尾空白则整体丢弃，而不是折叠后保留一个空格
+func canonicalizeBodyLineRelaxed(s string) string {
+	var b strings.Builder
+	pendingWSP := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			pendingWSP = true
+			continue
+		}
+		if pendingWSP {
+			b.WriteByte(' ')
+			pendingWSP = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+//collapseWSP 将连续的空格/制表符折叠为单个空格，并去掉首尾空白；仅用于头字段规范化，
+//行为与 canonicalizeBodyLineRelaxed 不同（后者保留折叠后的行首空格）
+func collapseWSP(s string) string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '\t'
+	})
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,96 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestSignerSignProducesVerifiableSignature(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := "Subject: hello\r\nFrom: a@example.com\r\nTo: b@example.com\r\n\r\nbody line one  \r\nbody line two\r\n\r\n\r\n"
+
+	signer := NewSigner("example.com", "selector1", priv, []string{"From", "To", "Subject"})
+
+	signed, err := signer.Sign([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(signed), "DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed; d=example.com; s=selector1;") {
+		t.Fatalf("unexpected DKIM-Signature header: %q", signed[:80])
+	}
+	if !bytes.Contains(signed, []byte(payload)) {
+		t.Fatal("expected original payload to follow the DKIM-Signature header unmodified")
+	}
+
+	dkimLine := strings.SplitN(string(signed), "\r\n", 2)[0]
+	dkimValue := strings.TrimPrefix(dkimLine, "DKIM-Signature: ")
+
+	bIdx := strings.LastIndex(dkimValue, "b=")
+	sigB64 := dkimValue[bIdx+2:]
+	sig, err := base64.StdEncoding.DecodeString(sigB64)
+	if err != nil {
+		t.Fatalf("b= is not valid base64: %v", err)
+	}
+
+	headerBlock, body, err := splitMessage([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, err := parseHeaders(headerBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bodyHash := sha256.Sum256(canonicalizeBodyRelaxed(body))
+	bh := base64.StdEncoding.EncodeToString(bodyHash[:])
+
+	var canon bytes.Buffer
+	for _, name := range []string{"From", "To", "Subject"} {
+		canon.WriteString(canonicalizeHeaderRelaxed(name, headers[strings.ToLower(name)]))
+	}
+	unsignedDKIMHeader := dkimValue[:bIdx+2]
+	canon.WriteString(canonicalizeHeaderRelaxed("DKIM-Signature", unsignedDKIMHeader))
+	signedData := bytes.TrimSuffix(canon.Bytes(), []byte("\r\n"))
+
+	hashed := sha256.Sum256(signedData)
+	if err := rsa.VerifyPKCS1v15(&priv.PublicKey, crypto.SHA256, hashed[:], sig); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+
+	if !strings.Contains(dkimValue, "bh="+bh) {
+		t.Errorf("DKIM-Signature bh= does not match the recomputed body hash")
+	}
+}
+
+func TestCanonicalizeBodyRelaxedTrimsTrailingBlankLines(t *testing.T) {
+	got := canonicalizeBodyRelaxed([]byte("line one  \r\nline two\r\n\r\n\r\n"))
+	want := "line one\r\nline two\r\n"
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCanonicalizeBodyRelaxedEmptyBody(t *testing.T) {
+	if got := canonicalizeBodyRelaxed([]byte("")); got != nil {
+		t.Errorf("got %q, want nil for an empty body", got)
+	}
+}
+
+func TestCanonicalizeBodyRelaxedCollapsesButKeepsLeadingAndInteriorWSP(t *testing.T) {
+	got := canonicalizeBodyRelaxed([]byte("  indented  content\r\nplain\r\n"))
+	want := " indented content\r\nplain\r\n"
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
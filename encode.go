@@ -0,0 +1,88 @@
+package xmailer
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+//maxEncodedWordLen 单个 RFC 2047 encoded-word 的最大长度，超出则拆分并用折叠空白连接
+const maxEncodedWordLen = 75
+
+//encodeHeaderValue 将可能包含非 ASCII 字符的邮件头字段值编码为 RFC 2047 encoded-word，
+//超长时拆成多个 encoded-word 并用 "\r\n " 折叠，ASCII 值原样返回
+func encodeHeaderValue(s string) string {
+	if isASCIIString(s) {
+		return s
+	}
+
+	var words []string
+	var chunk []rune
+
+	for _, r := range s {
+		chunk = append(chunk, r)
+		if len(mime.BEncoding.Encode("UTF-8", string(chunk))) > maxEncodedWordLen {
+			chunk = chunk[:len(chunk)-1]
+			words = append(words, mime.BEncoding.Encode("UTF-8", string(chunk)))
+			chunk = []rune{r}
+		}
+	}
+	if len(chunk) > 0 {
+		words = append(words, mime.BEncoding.Encode("UTF-8", string(chunk)))
+	}
+
+	return strings.Join(words, "\r\n ")
+}
+
+//encodeAddress 按 "Name <addr>" 的形式渲染地址头，display name 按需做 RFC 2047 编码
+func encodeAddress(name, addr string) string {
+	if name == "" {
+		return addr
+	}
+	return fmt.Sprintf("%s <%s>", encodeHeaderValue(name), addr)
+}
+
+//isASCIIString 判断字符串是否全部由 ASCII 字符组成
+func isASCIIString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+//encodeDispositionFilename 渲染 Content-Disposition 的 filename 参数，
+//非 ASCII 文件名按 RFC 2231 编码为 filename*=UTF-8''...
+func encodeDispositionFilename(filename string) string {
+	if isASCIIString(filename) {
+		return fmt.Sprintf("filename=\"%s\"", filename)
+	}
+	return fmt.Sprintf("filename*=UTF-8''%s", rfc2231Encode(filename))
+}
+
+//rfc2231Encode 对字符串做 RFC 2231 §7 描述的百分号编码
+func rfc2231Encode(s string) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isRFC2231Safe(c) {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+func isRFC2231Safe(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	switch c {
+	case '-', '.', '_', '~':
+		return true
+	}
+	return false
+}
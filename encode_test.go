@@ -0,0 +1,56 @@
+package xmailer
+
+import (
+	"mime"
+	"strings"
+	"testing"
+)
+
+func TestEncodeHeaderValueFoldsAcrossMultipleEncodedWords(t *testing.T) {
+	subject := strings.Repeat("测试折叠超长主题行", 10)
+
+	got := encodeHeaderValue(subject)
+
+	words := strings.Split(got, "\r\n ")
+	if len(words) < 2 {
+		t.Fatalf("got %d encoded-word(s), want at least 2 for a subject this long: %q", len(words), got)
+	}
+	for i, w := range words {
+		if len(w) > maxEncodedWordLen {
+			t.Errorf("word %d: got length %d, want <= %d: %q", i, len(w), maxEncodedWordLen, w)
+		}
+		if !strings.HasPrefix(strings.ToUpper(w), "=?UTF-8?B?") || !strings.HasSuffix(w, "?=") {
+			t.Errorf("word %d: got %q, want a UTF-8 B-encoded word", i, w)
+		}
+	}
+
+	decoded, err := new(mime.WordDecoder).DecodeHeader(got)
+	if err != nil {
+		t.Fatalf("failed to decode folded header value: %v", err)
+	}
+	if decoded != subject {
+		t.Errorf("got decoded %q, want %q", decoded, subject)
+	}
+}
+
+func TestEncodeHeaderValueASCIIPassesThrough(t *testing.T) {
+	if got := encodeHeaderValue("plain subject"); got != "plain subject" {
+		t.Errorf("got %q, want the original ASCII string unchanged", got)
+	}
+}
+
+func TestEncodeDispositionFilenameASCII(t *testing.T) {
+	got := encodeDispositionFilename("report.csv")
+	want := `filename="report.csv"`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestEncodeDispositionFilenameRFC2231(t *testing.T) {
+	got := encodeDispositionFilename("简历.pdf")
+	want := "filename*=UTF-8''%E7%AE%80%E5%8E%86.pdf"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -6,9 +6,10 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"mime"
 	"mime/multipart"
-	"net"
+	"mime/quotedprintable"
 	"net/smtp"
 	"os"
 	"path"
@@ -25,17 +26,22 @@ type Attachment struct {
 	ContentType string
 	FileName    string
 	BaseName    string
+	ContentID   string
+	Inline      bool
 	Content     []byte
+	Reader      io.Reader
 }
 
-//XMailer 邮件客户端
+//XMailer 是 Dialer 引入之前的邮件客户端实现，现在只是 Dialer 的一层瘦封装，仅为兼容
+//既有调用方保留。Send 经由 Dialer/SendCloser（见 dialer.go）发送，因此同样复用一条
+//长连接、空闲超时后重拨、断线后重试一次；内部的 Dialer 不对外暴露，无法设置 Signer，
+//经 XMailer 发送的邮件不会做 DKIM 签名。新代码请直接使用 NewDialer/NewDialerWithAuth
 type XMailer struct {
-	Addr      string
-	Host      string
-	auth      smtp.Auth
-	client    *smtp.Client
-	dialed    bool
-	tlsConfig *tls.Config
+	Addr string
+	Host string
+
+	dialer *Dialer
+	sender SendCloser
 }
 
 //Message 邮件消息体
@@ -49,191 +55,88 @@ type Message struct {
 	Text        string
 	HTML        string
 	Attachments []*Attachment
+	Embeds      []*Attachment
 }
 
-var boundary = generateBoundary()
-
 func NewXMailer(addr, username, passwd string) (*XMailer, error) {
-	pos := strings.Index(addr, ":")
-	if pos == -1 || pos == 0 || pos == len(addr)-1 {
-		return nil, fmt.Errorf("invalid smtp server address")
+	d, err := NewDialer(addr, username, passwd)
+	if err != nil {
+		return nil, err
 	}
 
-	host, _, err := net.SplitHostPort(addr)
+	return &XMailer{Addr: d.Addr, Host: d.Host, dialer: d}, nil
+}
 
+//NewXMailerWithAuth 使用调用方自行构造的 smtp.Auth 创建 XMailer，用于接入 LOGIN、
+//CRAM-MD5、XOAUTH2 等 smtp.PlainAuth 无法覆盖的鉴权方式
+func NewXMailerWithAuth(addr string, auth smtp.Auth) (*XMailer, error) {
+	d, err := NewDialerWithAuth(addr, auth)
 	if err != nil {
 		return nil, err
 	}
 
-	return &XMailer{
-		Addr:   addr,
-		Host:   host,
-		auth:   smtp.PlainAuth("", username, passwd, host),
-		dialed: false,
-	}, nil
+	return &XMailer{Addr: d.Addr, Host: d.Host, dialer: d}, nil
 }
 
 func NewXMailerWithStartTLS(addr, username, passwd string, tlsConfig *tls.Config) (*XMailer, error) {
-	pos := strings.Index(addr, ":")
-	if pos == -1 || pos == 0 || pos == len(addr)-1 {
-		return nil, fmt.Errorf("invalid smtp server address")
+	if tlsConfig == nil {
+		return nil, errors.New("Must specify the TLS config")
 	}
 
-	host, _, err := net.SplitHostPort(addr)
+	d, err := NewDialer(addr, username, passwd)
 	if err != nil {
 		return nil, err
 	}
+	d.StartTLS = true
+	d.TLSConfig = tlsConfig
 
-	if tlsConfig == nil {
-		return nil, errors.New("Must specify the TLS config")
-	}
-
-	return &XMailer{
-		Addr:      addr,
-		Host:      host,
-		auth:      smtp.PlainAuth("", username, passwd, host),
-		dialed:    false,
-		tlsConfig: tlsConfig,
-	}, nil
+	return &XMailer{Addr: d.Addr, Host: d.Host, dialer: d}, nil
 }
 
+//Send 沿用 Dialer 的拨号/发送路径：首次调用会自动 Dial，之后复用同一条连接，
+//继承其 keep-alive、空闲重拨和断线重试行为
 func (x *XMailer) Send(m *Message) error {
-
-	if !x.dialed {
-		x.Dial()
-	}
-
-	if m.FromAddr == "" {
-		return fmt.Errorf("Must specify the From address")
-	}
-
-	if len(m.To) == 0 {
-		return fmt.Errorf("Must specify at least one To address")
-	}
-
-	if m.Subject == "" {
-		m.Subject = "无题"
-	}
-
-	if err := x.client.Mail(m.FromAddr); err != nil {
-		return err
-	}
-
-	for _, t := range m.To {
-		if err := x.client.Rcpt(t); err != nil {
+	if x.sender == nil {
+		if err := x.Dial(); err != nil {
 			return err
 		}
 	}
 
-	w, err := x.client.Data()
-	if err != nil {
-		return err
-	}
-	defer w.Close()
-
-	payload, err := m.payload()
-	if err != nil {
-		return err
-	}
-
-	w.Write(payload)
-
-	return nil
-
+	return x.sender.Send(m)
 }
 
 func (x *XMailer) Dial() error {
-	co, err := smtp.Dial(x.Addr)
+	s, err := x.dialer.Dial()
 	if err != nil {
 		return err
 	}
-	x.client = co
-	if err = x.client.Hello(LocalName); err != nil {
-		return err
-	}
 
-	if ok, _ := x.client.Extension("STARTTLS"); ok {
-		var tlsConfig *tls.Config
-		if x.tlsConfig != nil {
-			tlsConfig = x.tlsConfig
-		} else {
-			tlsConfig = &tls.Config{ServerName: x.Host}
-		}
-		if err := x.client.StartTLS(tlsConfig); err != nil {
-			return err
-		}
-	}
-	if err := x.Auth(); err != nil {
-		return err
-	}
-
-	x.dialed = true
-	
+	x.sender = s
 	return nil
 }
 
 func (x *XMailer) DialWithTLS(t *tls.Config) error {
-	c, err := tls.Dial("tcp", x.Addr, t)
-	if err != nil {
-		return err
-	}
-
-	co, err := smtp.NewClient(c, x.Addr)
-	if err != nil {
-		return err
-	}
-
-	x.client = co
-
-	if err := x.client.Hello(LocalName); err != nil {
-		return err
-	}
-
-	if err := x.Auth(); err != nil {
-		return err
-	}
-	x.dialed = true
-	return nil
+	x.dialer.TLSConfig = t
+	x.dialer.StartTLS = false
+	return x.Dial()
 }
 
 func (x *XMailer) DialWithStartTLS(t *tls.Config) error {
-
-	co, err := smtp.Dial(x.Addr)
-	if err != nil {
-		return err
-	}
-
-	x.client = co
-	if err = x.client.Hello(LocalName); err != nil {
-		return err
-	}
-
-	if ok, _ := x.client.Extension("STARTTLS"); ok {
-		if err := x.client.StartTLS(t); err != nil {
-			return err
-		}
-	}
-
-	if err := x.Auth(); err != nil {
-		return err
-	}
-	x.dialed = true
-	return nil
+	x.dialer.TLSConfig = t
+	x.dialer.StartTLS = true
+	return x.Dial()
 }
 
+//Auth 不再需要显式调用：AUTH 协商现在是 Dial 握手的一部分（见 Dialer.dial）。
+//保留此方法只是为了不破坏编译期依赖旧 XMailer API 的调用方
 func (x *XMailer) Auth() error {
-
-	if ok, _ := x.client.Extension("AUTH"); ok {
-		if err := x.client.Auth(x.auth); err != nil {
-			return err
-		}
-	}
-
 	return nil
 }
 
 func (x *XMailer) Quit() {
-	x.client.Quit()
+	if x.sender != nil {
+		x.sender.Close()
+	}
 }
 
 //================= message api =================
@@ -299,88 +202,220 @@ func (m *Message) AttachFile(fileName string) error {
 	return nil
 }
 
+//AttachReader 将调用方已持有的 io.Reader 作为附件添加，适合内容已在内存中或来自网络流的场景；
+//内容会在发送时直接流式读取，不会被提前读入内存
+func (m *Message) AttachReader(name string, r io.Reader) {
+	name = strings.ReplaceAll(name, "\\", "/")
+
+	m.Attachments = append(m.Attachments, &Attachment{
+		ContentType: ParseContentTypeWithExt(name),
+		BaseName:    path.Base(name),
+		Reader:      r,
+	})
+}
+
+//AddEmbed 添加一个内联附件，供 HTML 正文通过 cid: 引用；未指定 ContentID 时自动生成一个
+func (m *Message) AddEmbed(a *Attachment) {
+	a.Inline = true
+	if a.ContentID == "" {
+		a.ContentID = generateContentID(a.BaseName)
+	}
+	m.Embeds = append(m.Embeds, a)
+}
+
+//EmbedFile 将一个磁盘文件登记为内联附件（内容在发送时才读取），并为其生成 ContentID；
+//追加到 m.Embeds 末尾的 Attachment.ContentID 可用于 HTML 中的 src="cid:..."
+func (m *Message) EmbedFile(fileName string) error {
+
+	fileName = strings.ReplaceAll(fileName, "\\", "/")
+
+	ct := ParseContentTypeWithExt(fileName)
+	finfo, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+	if finfo.IsDir() {
+		return fmt.Errorf("%s is not a file", fileName)
+	}
+
+	basename := path.Base(fileName)
+
+	m.Embeds = append(m.Embeds, &Attachment{
+		ContentType: ct,
+		FileName:    fileName,
+		BaseName:    basename,
+		ContentID:   generateContentID(basename),
+		Inline:      true,
+		Content:     nil,
+	})
+
+	return nil
+}
+
+//payload 将整封邮件拼装进内存，供需要完整 byte slice 的调用方使用（如 Signer.Sign）；
+//不需要签名的发送路径应优先使用 WriteTo 以避免大附件被整体读入内存
 func (m *Message) payload() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
 
-	messageID := generateMessageID()
+//WriteTo 将邮件以 RFC 2045/2046 MIME 结构流式写入 w，附件按 Content -> Reader -> FileName
+//的优先级取得内容来源，大文件通过固定大小的缓冲区边读边编码，不会被整体读入内存
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	ew := &errWriter{w: w}
 
-	payload := strings.Builder{}
-	payload.Grow(2048) //TODO: Guess a better buffer size
+	messageID := generateMessageID()
 
-	payload.WriteString(fmt.Sprintf("Message-Id: %s\r\nMime-Version: 1.0\r\nDate: %s\r\n", messageID, time.Now().Format(time.RFC1123Z)))
-	payload.WriteString(fmt.Sprintf("From: %s <%s>\r\n", m.FromName, m.FromAddr))
-	payload.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(m.To, ", ")))
+	ew.WriteString(fmt.Sprintf("Message-Id: %s\r\nMime-Version: 1.0\r\nDate: %s\r\n", messageID, time.Now().Format(time.RFC1123Z)))
+	ew.WriteString(fmt.Sprintf("From: %s\r\n", encodeAddress(m.FromName, m.FromAddr)))
+	ew.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(m.To, ", ")))
 
 	if len(m.CC) > 0 {
-		payload.WriteString(fmt.Sprintf("CC: %s\r\n", strings.Join(m.CC, ", ")))
+		ew.WriteString(fmt.Sprintf("CC: %s\r\n", strings.Join(m.CC, ", ")))
 	}
 	if len(m.Bcc) > 0 {
-		payload.WriteString(fmt.Sprintf("BCC: %s\r\n", strings.Join(m.Bcc, ", ")))
+		ew.WriteString(fmt.Sprintf("BCC: %s\r\n", strings.Join(m.Bcc, ", ")))
 	}
 
 	isMixed := len(m.Attachments) > 0
+	hasEmbeds := len(m.Embeds) > 0
 	isAlternative := len(m.Text) > 0 && len(m.HTML) > 0
 
+	boundary := generateBoundary()
+	relatedBoundary := generateBoundary()
+	altBoundary := generateBoundary()
+
 	switch {
 	case isMixed:
-		payload.WriteString(fmt.Sprintf("Content-Type: multipart/mixed;\r\n boundary=%s\r\n", boundary))
+		ew.WriteString(fmt.Sprintf("Content-Type: multipart/mixed;\r\n boundary=%s\r\n", boundary))
+	case hasEmbeds:
+		ew.WriteString(fmt.Sprintf("Content-Type: multipart/related;\r\n boundary=%s\r\n", relatedBoundary))
 	case isAlternative:
-		payload.WriteString(fmt.Sprintf("Content-Type: multipart/alternative;\r\n boundary=%s\r\n", boundary))
+		ew.WriteString(fmt.Sprintf("Content-Type: multipart/alternative;\r\n boundary=%s\r\n", boundary))
 	case len(m.HTML) > 0:
-		payload.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-		payload.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+		ew.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+		ew.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
 	default:
-		payload.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-		payload.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+		ew.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		ew.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
 	}
 
-	payload.WriteString(fmt.Sprintf("Subject: %s\r\n", m.Subject))
+	ew.WriteString(fmt.Sprintf("Subject: %s\r\n", encodeHeaderValue(m.Subject)))
 
-	if isMixed || isAlternative {
-		payload.WriteString(fmt.Sprintf("\r\n--%s\r\n", boundary))
+	if !isMixed && !hasEmbeds && !isAlternative {
+		// single-part body: no boundaries, the body follows directly after the headers
+		body := m.Text
+		if len(m.HTML) > 0 {
+			body = m.HTML
+		}
+		qp, err := quotedPrintableString(body)
+		if err != nil {
+			return ew.n, err
+		}
+		ew.WriteString(fmt.Sprintf("\r\n%s\r\n", qp))
+		return ew.n, ew.err
 	}
 
-	if len(m.Text) > 0 {
-		if isAlternative || isMixed {
-			payload.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-			payload.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	ew.WriteString("\r\n")
+
+	// nestedAlt is true when the body itself needs its own multipart/alternative child
+	// (both text and html are present); otherwise the single body part sits directly
+	// under multipart/related.
+	nestedAlt := hasEmbeds && isAlternative
+
+	// bodyBoundary is the boundary the text/html part(s) are written under. It nests one
+	// level deeper than usual whenever embeds are present, since the body then lives
+	// inside multipart/related.
+	bodyBoundary := boundary
+	switch {
+	case nestedAlt:
+		bodyBoundary = altBoundary
+	case hasEmbeds:
+		bodyBoundary = relatedBoundary
+	}
+
+	// The leading "--boundary" is only written here when something other than the
+	// first body/attachment part needs it to open (the nested multipart/related
+	// part below). Otherwise the first part written under the top-level boundary
+	// (a body or attachment part, or the nested multipart/alternative part)
+	// supplies its own opening delimiter, so writing it again here would
+	// duplicate it.
+	if isMixed && hasEmbeds {
+		ew.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	}
+
+	if hasEmbeds {
+		if isMixed {
+			ew.WriteString(fmt.Sprintf("Content-Type: multipart/related;\r\n boundary=%s\r\n\r\n", relatedBoundary))
 		}
-		payload.WriteString(fmt.Sprintf("\r\n%s\r\n", m.Text))
-		if isAlternative || isMixed {
-			payload.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+		if nestedAlt {
+			ew.WriteString(fmt.Sprintf("--%s\r\n", relatedBoundary))
+			ew.WriteString(fmt.Sprintf("Content-Type: multipart/alternative;\r\n boundary=%s\r\n\r\n", altBoundary))
 		}
 	}
 
+	if len(m.Text) > 0 {
+		ew.WriteString(fmt.Sprintf("--%s\r\n", bodyBoundary))
+		ew.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		ew.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+		qp, err := quotedPrintableString(m.Text)
+		if err != nil {
+			return ew.n, err
+		}
+		ew.WriteString(fmt.Sprintf("\r\n%s\r\n", qp))
+	}
+
 	if len(m.HTML) > 0 {
-		if isAlternative || isMixed {
-			payload.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-			payload.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+		ew.WriteString(fmt.Sprintf("--%s\r\n", bodyBoundary))
+		ew.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+		ew.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+		qp, err := quotedPrintableString(m.HTML)
+		if err != nil {
+			return ew.n, err
 		}
-		payload.WriteString(fmt.Sprintf("\r\n%s\r\n", m.HTML))
-		if isAlternative || isMixed {
-			payload.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+		ew.WriteString(fmt.Sprintf("\r\n%s\r\n", qp))
+	}
+
+	if nestedAlt {
+		ew.WriteString(fmt.Sprintf("--%s--\r\n", altBoundary))
+	}
+
+	if hasEmbeds {
+		for _, embed := range m.Embeds {
+			ew.WriteString(fmt.Sprintf("--%s\r\n", relatedBoundary))
+			ew.WriteString(fmt.Sprintf("Content-Disposition: inline;\r\n %s\r\n", encodeDispositionFilename(embed.BaseName)))
+			ew.WriteString(fmt.Sprintf("Content-Id: <%s>\r\n", embed.ContentID))
+			ew.WriteString("Content-Transfer-Encoding: base64\r\n")
+			ew.WriteString(fmt.Sprintf("Content-Type: %s\r\n\r\n", embed.ContentType))
+			if err := writeBase64Part(ew, embed); err != nil {
+				return ew.n, err
+			}
 		}
+
+		ew.WriteString(fmt.Sprintf("--%s--\r\n", relatedBoundary))
 	}
 
 	if isMixed {
 		for _, attachment := range m.Attachments {
-			if attachment.Content == nil {
-				content, err := readFile(attachment.FileName)
-				if err != nil {
-					return nil, err
-				}
-				attachment.Content = content
+			ew.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+			ew.WriteString(fmt.Sprintf("Content-Disposition: attachment;\r\n %s\r\n", encodeDispositionFilename(attachment.BaseName)))
+			ew.WriteString(fmt.Sprintf("Content-Id: <%s>\r\n", attachment.BaseName))
+			ew.WriteString("Content-Transfer-Encoding: base64\r\n")
+			ew.WriteString(fmt.Sprintf("Content-Type: %s\r\n\r\n", attachment.ContentType))
+			if err := writeBase64Part(ew, attachment); err != nil {
+				return ew.n, err
 			}
-
-			payload.WriteString(fmt.Sprintf("Content-Disposition: attachment;\r\n filename=\"%s\"\r\n", attachment.BaseName))
-			payload.WriteString(fmt.Sprintf("Content-Id: <%s>\r\n", attachment.BaseName))
-			payload.WriteString("Content-Transfer-Encoding: base64\r\n")
-			payload.WriteString(fmt.Sprintf("Content-Type: %s\r\n\r\n", attachment.ContentType))
-			payload.WriteString(base64.StdEncoding.EncodeToString(attachment.Content))
-			payload.WriteString(fmt.Sprintf("\r\n--%s\r\n", boundary))
 		}
+
+		ew.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+	} else if isAlternative && !hasEmbeds {
+		ew.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
 	}
 
-	return []byte(payload.String()), nil
+	return ew.n, ew.err
 }
 
 func (m *Message) Reset() {
@@ -391,6 +426,7 @@ func (m *Message) Reset() {
 	m.Bcc = nil
 	m.To = nil
 	m.Attachments = nil
+	m.Embeds = nil
 	m.HTML = ""
 	m.Text = ""
 }
@@ -407,6 +443,24 @@ func generateMessageID() string {
 	return fmt.Sprintf("%d.%d@%s", pid, t, h)
 }
 
+//quotedPrintableString 将文本按 RFC 2045 quoted-printable 规则编码
+func quotedPrintableString(s string) (string, error) {
+	var buf bytes.Buffer
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+//generateContentID 为内联附件生成一个稳定的 Content-ID，可在 HTML 中以 cid:<id> 引用
+func generateContentID(basename string) string {
+	return fmt.Sprintf("%d.%s@xmailer", time.Now().UnixNano(), basename)
+}
+
 func generateBoundary() string {
 	buf := bytes.NewBuffer(make([]byte, 70))
 	w := multipart.NewWriter(buf)
@@ -432,21 +486,118 @@ func ParseContentTypeWithExt(fileNameWithExt string) string {
 	return ct
 }
 
-func readFile(fileWithFullPath string) ([]byte, error) {
-	finfo, err := os.Stat(fileWithFullPath)
-	if err != nil {
-		return nil, err
+//base64LineLength 每行 base64 内容的最大列数，由 RFC 2045 §6.8 规定
+const base64LineLength = 76
+
+//errWriter 包装一个 io.Writer，记录累计写入的字节数和第一次出现的错误，
+//后续的 WriteString/Write 调用在出错后直接跳过，调用方只需在最后检查一次 err
+type errWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (ew *errWriter) WriteString(s string) {
+	if ew.err != nil {
+		return
 	}
+	n, err := io.WriteString(ew.w, s)
+	ew.n += int64(n)
+	ew.err = err
+}
+
+func (ew *errWriter) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	n, err := ew.w.Write(p)
+	ew.n += int64(n)
+	ew.err = err
+	return n, err
+}
 
-	size := finfo.Size()
-	buf := make([]byte, size)
+//lineWrapWriter 按 RFC 2045 要求每 base64LineLength 字节插入一个 CRLF；Finish 负责把最后
+//一个不满 76 列的行也补上换行，调用方必须在写完全部内容后调用一次 Finish
+type lineWrapWriter struct {
+	w       io.Writer
+	lineLen int
+}
 
-	fp, err := os.OpenFile(fileWithFullPath, os.O_RDONLY, 6)
+func (lw *lineWrapWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := base64LineLength - lw.lineLen
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := lw.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		lw.lineLen += n
+		p = p[n:]
+
+		if lw.lineLen == base64LineLength {
+			if _, err := lw.w.Write([]byte("\r\n")); err != nil {
+				return written, err
+			}
+			lw.lineLen = 0
+		}
+	}
+	return written, nil
+}
+
+//Finish 补上末尾不满一整行的换行符，没有残留内容时什么都不做
+func (lw *lineWrapWriter) Finish() error {
+	if lw.lineLen == 0 {
+		return nil
+	}
+	_, err := lw.w.Write([]byte("\r\n"))
+	lw.lineLen = 0
+	return err
+}
+
+//attachmentReader 按 Content -> Reader -> FileName 的优先级取得附件内容的来源；当内容来自
+//磁盘文件时返回的 io.Closer 由调用方负责关闭，其余情况下 closer 为 nil
+func attachmentReader(a *Attachment) (io.Reader, io.Closer, error) {
+	if a.Content != nil {
+		return bytes.NewReader(a.Content), nil, nil
+	}
+	if a.Reader != nil {
+		return a.Reader, nil, nil
+	}
+
+	f, err := os.Open(a.FileName)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	return f, f, nil
+}
+
+//writeBase64Part 将附件内容以 base64 编码流式写入 ew，每 76 列换行一次；内容全程以固定大小
+//的缓冲区搬运，不会把整个附件读入内存
+func writeBase64Part(ew *errWriter, a *Attachment) error {
+	r, closer, err := attachmentReader(a)
+	if err != nil {
+		return err
 	}
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	lw := &lineWrapWriter{w: ew}
+	enc := base64.NewEncoder(base64.StdEncoding, lw)
 
-	_, err = fp.Read(buf)
+	buf := make([]byte, 32*1024)
+	if _, err := io.CopyBuffer(enc, r, buf); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	if err := lw.Finish(); err != nil {
+		return err
+	}
 
-	return buf, err
+	return ew.err
 }
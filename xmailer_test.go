@@ -1,6 +1,13 @@
 package xmailer
 
 import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
 	"testing"
 )
 
@@ -29,3 +36,289 @@ func TestSend(t *testing.T) {
 	}
 
 }
+
+func TestMessagePayloadRoundTrip(t *testing.T) {
+	m := NewMessage()
+	m.SetFrom("测试账号", "from@example.com")
+	m.SetSubject("你好，世界 - Hello World")
+	m.AddTo("to@example.com")
+	m.SetText("纯文本内容")
+	m.SetHTML("<p>HTML 内容</p>")
+
+	raw, err := m.payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("net/mail failed to parse payload: %v", err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("failed to decode subject: %v", err)
+	}
+	if subject != m.Subject {
+		t.Errorf("got subject %q, want %q", subject, m.Subject)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("failed to parse Content-Type: %v", err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("got content type %q, want multipart/alternative", mediaType)
+	}
+
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	parts := 0
+	for {
+		_, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read part %d: %v", parts, err)
+		}
+		parts++
+	}
+	if parts != 2 {
+		t.Errorf("got %d parts, want 2 (text + html)", parts)
+	}
+}
+
+func TestMessageWithEmbedIsNestedUnderRelated(t *testing.T) {
+	m := NewMessage()
+	m.SetFrom("longmon", "from@example.com")
+	m.SetSubject("Embedded image")
+	m.AddTo("to@example.com")
+	m.SetHTML(`<img src="cid:logo.png">`)
+
+	m.AddEmbed(&Attachment{
+		ContentType: "image/png",
+		BaseName:    "logo.png",
+		Content:     []byte("fake-png-bytes"),
+	})
+
+	raw, err := m.payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("net/mail failed to parse payload: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("failed to parse Content-Type: %v", err)
+	}
+	if mediaType != "multipart/related" {
+		t.Fatalf("got content type %q, want multipart/related", mediaType)
+	}
+
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+
+	htmlPart, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read html part: %v", err)
+	}
+	if ct := htmlPart.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("got first related part content type %q, want text/html", ct)
+	}
+
+	imgPart, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read embedded image part: %v", err)
+	}
+	if cid := imgPart.Header.Get("Content-Id"); cid == "" {
+		t.Error("embedded image part is missing a Content-Id header")
+	}
+	if disp := imgPart.Header.Get("Content-Disposition"); !strings.HasPrefix(disp, "inline") {
+		t.Errorf("got embedded image disposition %q, want inline", disp)
+	}
+
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("expected exactly 2 related parts, got extra: %v", err)
+	}
+}
+
+func TestMessageWriteToRoundTripsReaderAttachment(t *testing.T) {
+	m := NewMessage()
+	m.SetFrom("longmon", "from@example.com")
+	m.SetSubject("Streaming attachment")
+	m.AddTo("to@example.com")
+	m.SetText("body")
+	m.AttachReader("report.csv", strings.NewReader("a,b,c\n1,2,3\n"))
+
+	var buf bytes.Buffer
+	n, err := m.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("got n=%d, want %d (buf.Len())", n, buf.Len())
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("net/mail failed to parse WriteTo output: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("failed to parse Content-Type: %v", err)
+	}
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("got content type %q, want multipart/mixed", mediaType)
+	}
+
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+
+	if _, err := mr.NextPart(); err != nil {
+		t.Fatalf("failed to read text part: %v", err)
+	}
+
+	attachPart, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read attachment part: %v", err)
+	}
+	content, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachPart))
+	if err != nil {
+		t.Fatalf("failed to decode attachment content: %v", err)
+	}
+	if string(content) != "a,b,c\n1,2,3\n" {
+		t.Errorf("got attachment content %q, want %q", content, "a,b,c\n1,2,3\n")
+	}
+}
+
+func TestMessageSubjectFoldsAcrossEncodedWords(t *testing.T) {
+	m := NewMessage()
+	m.SetFrom("longmon", "from@example.com")
+	m.SetSubject(strings.Repeat("测试折叠超长主题行", 10))
+	m.AddTo("to@example.com")
+	m.SetText("body")
+
+	raw, err := m.payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// net/mail unfolds continuation lines on parse, so check the fold on the
+	// wire bytes before parsing
+	if !strings.Contains(string(raw), "?=\r\n =?") {
+		t.Errorf("got payload %q, want the Subject header folded across multiple encoded words", raw)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("net/mail failed to parse payload: %v", err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("failed to decode subject: %v", err)
+	}
+	if subject != m.Subject {
+		t.Errorf("got subject %q, want %q", subject, m.Subject)
+	}
+}
+
+func TestWriteBase64PartWrapsAt76Columns(t *testing.T) {
+	m := NewMessage()
+	m.SetFrom("longmon", "from@example.com")
+	m.SetSubject("attachment wrap")
+	m.AddTo("to@example.com")
+	m.SetText("body")
+
+	content := strings.Repeat("0123456789", 30) // 300 bytes -> 400 base64 chars, several 76-col lines
+	m.AttachReader("data.bin", strings.NewReader(content))
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("net/mail failed to parse WriteTo output: %v", err)
+	}
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("failed to parse Content-Type: %v", err)
+	}
+
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	if _, err := mr.NextPart(); err != nil {
+		t.Fatalf("failed to read text part: %v", err)
+	}
+	attachPart, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read attachment part: %v", err)
+	}
+
+	raw, err := io.ReadAll(attachPart)
+	if err != nil {
+		t.Fatalf("failed to read raw attachment body: %v", err)
+	}
+	lines := strings.Split(strings.TrimRight(string(raw), "\r\n"), "\r\n")
+	if len(lines) < 2 {
+		t.Fatalf("got %d line(s), want the base64 body to wrap across multiple 76-column lines", len(lines))
+	}
+	for i, line := range lines[:len(lines)-1] {
+		if len(line) != 76 {
+			t.Errorf("line %d: got length %d, want 76", i, len(line))
+		}
+	}
+	if last := lines[len(lines)-1]; len(last) == 0 || len(last) > 76 {
+		t.Errorf("got last line length %d, want 1-76", len(last))
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(lines, ""))
+	if err != nil {
+		t.Fatalf("failed to decode wrapped base64 content: %v", err)
+	}
+	if string(decoded) != content {
+		t.Errorf("got decoded attachment content %q, want %q", decoded, content)
+	}
+}
+
+func TestAttachmentFilenameRFC2231RoundTrip(t *testing.T) {
+	m := NewMessage()
+	m.SetFrom("longmon", "from@example.com")
+	m.SetSubject("attachment filename")
+	m.AddTo("to@example.com")
+	m.SetText("body")
+
+	const filename = "简历 résumé.pdf"
+	m.AttachReader(filename, strings.NewReader("pdf bytes"))
+
+	raw, err := m.payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("net/mail failed to parse payload: %v", err)
+	}
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("failed to parse Content-Type: %v", err)
+	}
+
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	if _, err := mr.NextPart(); err != nil {
+		t.Fatalf("failed to read text part: %v", err)
+	}
+	attachPart, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read attachment part: %v", err)
+	}
+
+	if got := attachPart.FileName(); got != filename {
+		t.Errorf("got filename %q, want %q", got, filename)
+	}
+}